@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// errNotPermitted is returned for mailbox-mutation commands this
+// read-mostly backend doesn't support. imapserver only exports
+// ErrAuthFailed as a sentinel; any other error is reported to the client
+// as a generic NO response.
+var errNotPermitted = errors.New("operation not permitted")
+
+// imapSession is a single IMAP connection. A session is only ever bound to
+// one mailbox: the inbox of the user it logged in as, matching the rest of
+// this server's single-inbox-per-address model.
+type imapSession struct {
+	app      *App
+	apiKeys  map[string]bool
+	username string
+	selected bool
+}
+
+func serveIMAP(addr string, app *App, apiKeys map[string]bool, tlsConfig *tls.Config) error {
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, *imapserver.GreetingData, error) {
+			return &imapSession{app: app, apiKeys: apiKeys}, nil, nil
+		},
+		Caps:      imap.CapSet{imap.CapIMAP4rev1: struct{}{}},
+		TLSConfig: tlsConfig,
+	})
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(ln)
+}
+
+// Login treats the API key as the password and the recipient local-part as
+// the username, so any mailbox owner holding the shared API key can read
+// their own inbox without a separate credential store.
+func (s *imapSession) Login(username, password string) error {
+	if username == "" || password == "" || !s.apiKeys[password] {
+		return imapserver.ErrAuthFailed
+	}
+	s.username = username
+	return nil
+}
+
+func (s *imapSession) Close() error { return nil }
+
+func (s *imapSession) Select(mailbox string, options *imap.SelectOptions) (*imap.SelectData, error) {
+	if !strings.EqualFold(mailbox, "INBOX") {
+		return nil, fmt.Errorf("no such mailbox: %s", mailbox)
+	}
+	uids, err := listUIDs(context.Background(), s.app.Redis, s.username)
+	if err != nil {
+		return nil, err
+	}
+	s.selected = true
+	return &imap.SelectData{
+		NumMessages: uint32(len(uids)),
+		UIDNext:     imap.UID(nextUIDHint(uids)),
+		UIDValidity: 1,
+	}, nil
+}
+
+func (s *imapSession) Unselect() error {
+	s.selected = false
+	return nil
+}
+
+func (s *imapSession) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	return w.WriteList(&imap.ListData{Mailbox: "INBOX"})
+}
+
+func (s *imapSession) Status(mailbox string, options *imap.StatusOptions) (*imap.StatusData, error) {
+	uids, err := listUIDs(context.Background(), s.app.Redis, s.username)
+	if err != nil {
+		return nil, err
+	}
+	data := &imap.StatusData{Mailbox: mailbox}
+	if options.NumMessages {
+		n := uint32(len(uids))
+		data.NumMessages = &n
+	}
+	if options.UIDNext {
+		data.UIDNext = imap.UID(nextUIDHint(uids))
+	}
+	return data, nil
+}
+
+func (s *imapSession) Fetch(w *imapserver.FetchWriter, numSet imap.NumSet, options *imap.FetchOptions) error {
+	ctx := context.Background()
+	entries, err := s.resolveSet(ctx, numSet)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		msg, err := loadMessage(ctx, s.app.Redis, s.username, entry.UID)
+		if err != nil {
+			continue
+		}
+		fw := w.CreateMessage(entry.Seq)
+		if options.UID {
+			fw.WriteUID(imap.UID(msg.UID))
+		}
+		if options.Flags {
+			fw.WriteFlags(stringsToFlags(msg.Flags))
+		}
+		for _, bs := range options.BodySection {
+			wc := fw.WriteBodySection(bs, int64(len(msg.Raw)))
+			_, writeErr := wc.Write(msg.Raw)
+			closeErr := wc.Close()
+			if writeErr != nil {
+				return writeErr
+			}
+			if closeErr != nil {
+				return closeErr
+			}
+		}
+		if err := fw.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *imapSession) Store(w *imapserver.FetchWriter, numSet imap.NumSet, flags *imap.StoreFlags, options *imap.StoreOptions) error {
+	ctx := context.Background()
+	entries, err := s.resolveSet(ctx, numSet)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		msg, err := loadMessage(ctx, s.app.Redis, s.username, entry.UID)
+		if err != nil {
+			continue
+		}
+		updated := applyStoreFlags(msg.Flags, flags)
+		if err := setFlags(ctx, s.app.Redis, s.username, entry.UID, updated); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *imapSession) Expunge(w *imapserver.ExpungeWriter, uidSet *imap.UIDSet) error {
+	ctx := context.Background()
+	uids, err := listUIDs(ctx, s.app.Redis, s.username)
+	if err != nil {
+		return err
+	}
+	for _, uid := range uids {
+		if uidSet != nil && !uidSet.Contains(imap.UID(uid)) {
+			continue
+		}
+		msg, err := loadMessage(ctx, s.app.Redis, s.username, uid)
+		if err != nil || !hasFlag(msg.Flags, imap.FlagDeleted) {
+			continue
+		}
+		if err := deleteMessage(ctx, s.app.Redis, s.username, uid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Operations this read-mostly backend doesn't support; Redis is the single
+// source of truth and is populated only by inbound SMTP delivery.
+func (s *imapSession) Create(mailbox string, options *imap.CreateOptions) error { return errNotPermitted }
+func (s *imapSession) Delete(mailbox string) error                             { return errNotPermitted }
+func (s *imapSession) Rename(mailbox, newName string, options *imap.RenameOptions) error {
+	return errNotPermitted
+}
+func (s *imapSession) Subscribe(mailbox string) error   { return nil }
+func (s *imapSession) Unsubscribe(mailbox string) error { return nil }
+func (s *imapSession) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	return nil, errNotPermitted
+}
+func (s *imapSession) Copy(numSet imap.NumSet, dest string) (*imap.CopyData, error) {
+	return nil, errNotPermitted
+}
+func (s *imapSession) Search(kind imapserver.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	return &imap.SearchData{}, nil
+}
+func (s *imapSession) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error { return nil }
+func (s *imapSession) Idle(w *imapserver.UpdateWriter, stop <-chan struct{}) error {
+	<-stop
+	return nil
+}
+
+// seqUID pairs a UID with the 1-based sequence number it holds in the
+// mailbox, since FETCH/STORE responses for a plain (non-UID) NumSet must be
+// labeled with that sequence number, not with its position in a filtered
+// subset.
+type seqUID struct {
+	Seq uint32
+	UID uint32
+}
+
+func (s *imapSession) resolveSet(ctx context.Context, numSet imap.NumSet) ([]seqUID, error) {
+	all, err := listUIDs(ctx, s.app.Redis, s.username)
+	if err != nil {
+		return nil, err
+	}
+	return filterNumSet(all, numSet), nil
+}
+
+// filterNumSet maps a mailbox's UIDs (ordered by sequence number, oldest
+// first) through numSet, returning only the matching entries alongside
+// their true sequence numbers.
+func filterNumSet(all []uint32, numSet imap.NumSet) []seqUID {
+	out := make([]seqUID, 0, len(all))
+	for i, uid := range all {
+		seqNum := uint32(i + 1)
+		switch set := numSet.(type) {
+		case imap.UIDSet:
+			if set.Contains(imap.UID(uid)) {
+				out = append(out, seqUID{Seq: seqNum, UID: uid})
+			}
+		case imap.SeqSet:
+			if set.Contains(seqNum) {
+				out = append(out, seqUID{Seq: seqNum, UID: uid})
+			}
+		default:
+			out = append(out, seqUID{Seq: seqNum, UID: uid})
+		}
+	}
+	return out
+}
+
+func nextUIDHint(uids []uint32) uint32 {
+	if len(uids) == 0 {
+		return 1
+	}
+	return uids[len(uids)-1] + 1
+}
+
+func stringsToFlags(flags []string) []imap.Flag {
+	out := make([]imap.Flag, len(flags))
+	for i, f := range flags {
+		out[i] = imap.Flag(f)
+	}
+	return out
+}
+
+func hasFlag(flags []string, target imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, string(target)) {
+			return true
+		}
+	}
+	return false
+}
+
+func applyStoreFlags(current []string, op *imap.StoreFlags) []string {
+	set := make(map[string]bool, len(current))
+	for _, f := range current {
+		set[f] = true
+	}
+	switch op.Op {
+	case imap.StoreFlagsSet:
+		set = make(map[string]bool, len(op.Flags))
+		for _, f := range op.Flags {
+			set[string(f)] = true
+		}
+	case imap.StoreFlagsAdd:
+		for _, f := range op.Flags {
+			set[string(f)] = true
+		}
+	case imap.StoreFlagsDel:
+		for _, f := range op.Flags {
+			delete(set, string(f))
+		}
+	}
+	out := make([]string, 0, len(set))
+	for f := range set {
+		out = append(out, f)
+	}
+	return out
+}
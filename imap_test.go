@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func sortedFlags(flags []string) []string {
+	out := append([]string(nil), flags...)
+	sort.Strings(out)
+	return out
+}
+
+func TestApplyStoreFlagsAdd(t *testing.T) {
+	got := applyStoreFlags([]string{"\\Seen"}, &imap.StoreFlags{
+		Op:    imap.StoreFlagsAdd,
+		Flags: []imap.Flag{imap.FlagFlagged},
+	})
+	want := []string{"\\Flagged", "\\Seen"}
+	if !reflect.DeepEqual(sortedFlags(got), want) {
+		t.Fatalf("got %v, want %v", sortedFlags(got), want)
+	}
+}
+
+func TestApplyStoreFlagsDel(t *testing.T) {
+	got := applyStoreFlags([]string{"\\Seen", "\\Flagged"}, &imap.StoreFlags{
+		Op:    imap.StoreFlagsDel,
+		Flags: []imap.Flag{imap.FlagFlagged},
+	})
+	want := []string{"\\Seen"}
+	if !reflect.DeepEqual(sortedFlags(got), want) {
+		t.Fatalf("got %v, want %v", sortedFlags(got), want)
+	}
+}
+
+func TestApplyStoreFlagsSet(t *testing.T) {
+	got := applyStoreFlags([]string{"\\Seen", "\\Flagged"}, &imap.StoreFlags{
+		Op:    imap.StoreFlagsSet,
+		Flags: []imap.Flag{imap.FlagDeleted},
+	})
+	want := []string{"\\Deleted"}
+	if !reflect.DeepEqual(sortedFlags(got), want) {
+		t.Fatalf("got %v, want %v", sortedFlags(got), want)
+	}
+}
+
+func TestFilterNumSetSeqRangeKeepsTrueSequenceNumbers(t *testing.T) {
+	all := []uint32{10, 20, 30, 40, 50} // seq 1..5
+	got := filterNumSet(all, imap.SeqSet{{Start: 3, Stop: 5}})
+	want := []seqUID{{Seq: 3, UID: 30}, {Seq: 4, UID: 40}, {Seq: 5, UID: 50}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFilterNumSetUIDRange(t *testing.T) {
+	all := []uint32{10, 20, 30, 40, 50}
+	got := filterNumSet(all, imap.UIDSet{{Start: imap.UID(20), Stop: imap.UID(40)}})
+	want := []seqUID{{Seq: 2, UID: 20}, {Seq: 3, UID: 30}, {Seq: 4, UID: 40}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestFilterNumSetFallsThroughToAll(t *testing.T) {
+	all := []uint32{10, 20, 30}
+	got := filterNumSet(all, nil)
+	want := []seqUID{{Seq: 1, UID: 10}, {Seq: 2, UID: 20}, {Seq: 3, UID: 30}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// logLevel backs the process-wide logger and can be changed at runtime via
+// SIGHUP (reload from LOG_LEVEL) or the /admin/log-level endpoint, without
+// restarting the server.
+var logLevel = new(slog.LevelVar)
+
+var logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
+
+func init() {
+	logLevel.Set(parseLogLevel(os.Getenv("LOG_LEVEL")))
+}
+
+func parseLogLevel(s string) slog.Level {
+	switch s {
+	case "debug", "DEBUG":
+		return slog.LevelDebug
+	case "warn", "WARN":
+		return slog.LevelWarn
+	case "error", "ERROR":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// watchLogLevelReload re-reads LOG_LEVEL from the environment on SIGHUP so
+// operators can flip to debug logging on a running server and flip back
+// later, without a restart.
+func watchLogLevelReload() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			level := parseLogLevel(os.Getenv("LOG_LEVEL"))
+			logLevel.Set(level)
+			logger.Info("log level reloaded via SIGHUP", "level", level.String())
+		}
+	}()
+}
+
+// dataRingBuffer holds the last N raw SMTP DATA payloads so an operator can
+// inspect exactly what was received while debugging a delivery issue,
+// without having to reproduce it. Only populated while debug logging is
+// enabled.
+type dataRingBuffer struct {
+	mu      sync.Mutex
+	entries [][]byte
+	cap     int
+}
+
+func newDataRingBuffer(cap int) *dataRingBuffer {
+	return &dataRingBuffer{cap: cap}
+}
+
+func (b *dataRingBuffer) Add(payload []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cp := make([]byte, len(payload))
+	copy(cp, payload)
+	b.entries = append(b.entries, cp)
+	if len(b.entries) > b.cap {
+		b.entries = b.entries[len(b.entries)-b.cap:]
+	}
+}
+
+func (b *dataRingBuffer) Snapshot() [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([][]byte, len(b.entries))
+	copy(out, b.entries)
+	return out
+}
+
+var debugDump = newDataRingBuffer(32)
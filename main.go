@@ -1,16 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 
 	"crypto/tls"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -22,7 +24,13 @@ import (
 )
 
 type App struct {
-	Redis *redis.Client
+	Redis      *redis.Client
+	Notify     *notifyDispatcher
+	Policy     *policyConfig
+	Search     *searchIndex
+	Blob       BlobStore
+	QuotaBytes int64
+	RateLimit  *rateLimitConfig
 }
 
 var (
@@ -38,19 +46,26 @@ func init() {
 type Backend struct{ app *App }
 
 type Session struct {
-	app  *App
-	from string
-	to   string
+	app         *App
+	remoteAddr  string
+	remoteHost  string
+	remoteIP    net.IP
+	helo        string
+	from        string
+	to          string
+	authResults []authResult
 }
 
 func (s *Session) Mail(from string, opts *smtp.MailOptions) error {
 	s.from = from
+	logger.Debug("MAIL FROM", "remote_addr", s.remoteAddr, "from", from)
 	return nil
 }
 
 func (s *Session) Rcpt(to string, opts *smtp.RcptOptions) error {
 	addr, err := mail.ParseAddress(to)
 	if err != nil {
+		logger.Warn("RCPT TO rejected: unparsable address", "remote_addr", s.remoteAddr, "to", to, "error", err)
 		return err
 	}
 
@@ -62,34 +77,155 @@ func (s *Session) Rcpt(to string, opts *smtp.RcptOptions) error {
 	domain := parts[1]
 
 	if !strings.EqualFold(domain, allowedDomain) {
+		logger.Warn("RCPT TO rejected: domain not allowed", "remote_addr", s.remoteAddr, "from", s.from, "to", addr.Address, "domain", domain)
 		return fmt.Errorf("550 5.1.1 recipient domain not allowed: %s", domain)
 	}
 
 	s.to = addr.Address
 
+	ctx := context.Background()
+	policy := s.app.Policy
+
+	if policy.RBL.Enabled && s.remoteIP != nil {
+		s.authResults = append(s.authResults, checkRBL(policy, s.remoteIP))
+	}
+	if policy.SPF.Enabled && s.remoteIP != nil {
+		s.authResults = append(s.authResults, checkSPF(ctx, s.remoteIP, s.from, s.helo))
+	}
+	if policy.Greylist.Enabled && !checkGreylist(ctx, s.app.Redis, policy, s.remoteHost, s.from, s.to) {
+		logger.Info("RCPT TO greylisted", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to)
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+			Message:      "greylisted, please retry later",
+		}
+	}
+	if reason, action, reject := anyRejected(policy, s.authResults); reject && action == actionReject {
+		logger.Warn("RCPT TO rejected by policy", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to, "method", reason.Method, "reason", reason.Reason)
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      fmt.Sprintf("rejected by policy: %s check failed", reason.Method),
+		}
+	}
+
+	logger.Debug("RCPT TO", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to)
+
 	return nil
 }
 
 func (b *Backend) NewSession(c *smtp.Conn) (smtp.Session, error) {
-	return &Session{app: b.app}, nil
+	remoteAddr := c.Conn().RemoteAddr().String()
+	host, _, err := net.SplitHostPort(remoteAddr)
+	var ip net.IP
+	if err == nil {
+		ip = net.ParseIP(host)
+	} else {
+		host = remoteAddr
+	}
+
+	connKey := fmt.Sprintf("ratelimit:smtp:conn:%s", host)
+	res, err := allow(context.Background(), b.app.Redis, connKey, b.app.RateLimit.SMTPConnPerIP)
+	if err != nil {
+		return nil, err
+	}
+	if !res.Allowed {
+		logger.Warn("connection rejected: rate limit exceeded", "remote_addr", remoteAddr, "response_code", 421)
+		return nil, &smtp.SMTPError{
+			Code:         421,
+			EnhancedCode: smtp.EnhancedCode{4, 7, 0},
+			Message:      fmt.Sprintf("too many connections, retry in %ds", res.ResetMS/1000),
+		}
+	}
+
+	return &Session{app: b.app, remoteAddr: remoteAddr, remoteHost: host, remoteIP: ip, helo: c.Hostname()}, nil
 }
 
 func (s *Session) Data(r io.Reader) error {
 
 	ctx := context.Background()
+	senderKey := fmt.Sprintf("ratelimit:smtp:sender:%s", s.from)
+
+	senderRes, err := allow(ctx, s.app.Redis, senderKey, s.app.RateLimit.MessagesPerSender)
+	if err != nil {
+		return err
+	}
+	if !senderRes.Allowed {
+		logger.Warn("DATA rejected: sender rate limit exceeded", "remote_addr", s.remoteAddr, "from", s.from, "rate_limit_key", senderKey, "response_code", 451)
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+			Message:      fmt.Sprintf("rate limit exceeded, retry in %ds", senderRes.ResetMS/1000),
+		}
+	}
+
+	recipientKey := fmt.Sprintf("ratelimit:smtp:recipient:%s", s.to)
+	recipientRes, err := allow(ctx, s.app.Redis, recipientKey, s.app.RateLimit.MessagesPerRecipient)
+	if err != nil {
+		return err
+	}
+	if !recipientRes.Allowed {
+		logger.Warn("DATA rejected: recipient rate limit exceeded", "remote_addr", s.remoteAddr, "to", s.to, "rate_limit_key", recipientKey, "response_code", 451)
+		return &smtp.SMTPError{
+			Code:         451,
+			EnhancedCode: smtp.EnhancedCode{4, 7, 1},
+			Message:      fmt.Sprintf("rate limit exceeded, retry in %ds", recipientRes.ResetMS/1000),
+		}
+	}
+
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
 
-	if !allow(ctx, s.app.Redis, fmt.Sprintf("smtp:%s", s.from), 50, time.Minute) {
-		return fmt.Errorf("rate limit exceeded")
+	if logLevel.Level() <= slog.LevelDebug {
+		debugDump.Add(raw)
 	}
 
-	mr, err := mail.CreateReader(r)
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
 	if err != nil {
+		logger.Error("DATA rejected: malformed message", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to, "error", err, "response_code", 554)
 		return err
 	}
 
+	policy := s.app.Policy
+	if policy.DKIM.Enabled {
+		s.authResults = append(s.authResults, checkDKIM(raw))
+	}
+	if policy.DMARC.Enabled {
+		spfRes, dkimRes := authResult{Result: "none"}, authResult{Result: "none"}
+		for _, r := range s.authResults {
+			switch r.Method {
+			case "spf":
+				spfRes = r
+			case "dkim":
+				dkimRes = r
+			}
+		}
+		// DMARC aligns against the visible RFC 5322 From: header, not the
+		// envelope MAIL FROM — otherwise SPF-passing on the envelope domain
+		// alone would rubber-stamp a forged From: header.
+		var fromHeaderDomainVal string
+		if addr, err := mail.ParseAddress(mr.Header.Get("From")); err == nil {
+			fromHeaderDomainVal = fromHeaderDomain(addr.Address)
+		}
+		s.authResults = append(s.authResults, checkDMARC(fromHeaderDomainVal, spfRes, dkimRes))
+	}
+	if reason, action, reject := anyRejected(policy, s.authResults); reject && action == actionReject {
+		logger.Warn("DATA rejected by policy", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to, "method", reason.Method, "reason", reason.Reason, "response_code", 550)
+		return &smtp.SMTPError{
+			Code:         550,
+			EnhancedCode: smtp.EnhancedCode{5, 7, 1},
+			Message:      fmt.Sprintf("rejected by policy: %s check failed", reason.Method),
+		}
+	}
+	if len(s.authResults) > 0 {
+		raw = append([]byte(authResultsHeader(allowedDomain, s.authResults)), raw...)
+	}
+
 	var bodyText string
 	var bodyHTML string
-	attachments := []string{}
+	attachments := []AttachmentMeta{}
 
 	for {
 		part, err := mr.NextPart()
@@ -114,26 +250,40 @@ func (s *Session) Data(r io.Reader) error {
 
 		case *mail.AttachmentHeader:
 			filename, _ := h.Filename()
-			attachments = append(attachments, filename)
+			ct, _, _ := h.ContentType()
+			body, _ := io.ReadAll(part.Body)
+			username := parseUsername(s.to)
+			attachments = append(attachments, storeAttachment(ctx, s.app, username, filename, ct, body, s.app.QuotaBytes))
 		}
 	}
 
 	username := parseUsername(s.to)
-	msg := map[string]any{
-		"id":          fmt.Sprintf("%d", time.Now().UnixNano()),
-		"from":        s.from,
-		"to":          s.to,
-		"subject":     mr.Header.Get("Subject"),
-		"body_text":   bodyText,
-		"body_html":   bodyHTML,
-		"attachments": attachments,
-		"received_at": time.Now().Unix(),
-	}
-
-	j, _ := json.Marshal(msg)
-	key := fmt.Sprintf("inbox:%s", username)
-	s.app.Redis.LPush(ctx, key, j)
-	s.app.Redis.Expire(ctx, key, 24*time.Hour)
+	msg := &StoredMessage{
+		From:        s.from,
+		To:          s.to,
+		Subject:     mr.Header.Get("Subject"),
+		BodyText:    bodyText,
+		BodyHTML:    bodyHTML,
+		Attachments: attachments,
+		ReceivedAt:  time.Now().Unix(),
+		AuthResults: s.authResults,
+		Raw:         raw,
+	}
+
+	uid, err := saveMessage(ctx, s.app.Redis, username, msg)
+	if err != nil {
+		logger.Error("failed to store message", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to, "error", err, "response_code", 451)
+		return err
+	}
+	msg.UID = uid
+	if err := s.app.Search.Index(username, msg); err != nil {
+		logger.Warn("failed to index message for search", "username", username, "uid", uid, "error", err)
+	}
+
+	logger.Info("message accepted", "remote_addr", s.remoteAddr, "from", s.from, "to", s.to,
+		"message_id", mr.Header.Get("Message-Id"), "uid", uid, "response_code", 250)
+
+	go s.app.Notify.Dispatch(context.Background(), username, msg)
 
 	return nil
 }
@@ -141,14 +291,6 @@ func (s *Session) Data(r io.Reader) error {
 func (s *Session) Reset()        {}
 func (s *Session) Logout() error { return nil }
 
-func allow(ctx context.Context, rdb *redis.Client, key string, limit int, window time.Duration) bool {
-	pipe := rdb.TxPipeline()
-	incr := pipe.Incr(ctx, key)
-	pipe.Expire(ctx, key, window)
-	_, _ = pipe.Exec(ctx)
-	return incr.Val() <= int64(limit)
-}
-
 func APIKeyAuthMiddleware(validKeys map[string]bool) gin.HandlerFunc {
 
 	return func(c *gin.Context) {
@@ -161,6 +303,14 @@ func APIKeyAuthMiddleware(validKeys map[string]bool) gin.HandlerFunc {
 	}
 }
 
+func parseUID(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid message id: %s", s)
+	}
+	return uint32(n), nil
+}
+
 func parseUsername(addr string) string {
 	at := strings.Index(addr, "@")
 	if at == -1 {
@@ -170,15 +320,53 @@ func parseUsername(addr string) string {
 }
 
 func main() {
+	watchLogLevelReload()
+
 	redisAddr := getenv("REDIS_ADDR", "localhost:6379")
-	redis := redis.NewClient(&redis.Options{Addr: redisAddr})
-	app := &App{Redis: redis}
+	rdb := redis.NewClient(&redis.Options{Addr: redisAddr})
+	app := &App{Redis: rdb}
+	app.Notify = newNotifyDispatcher(app, getenv("NOTIFY_CONFIG", ""))
+	app.Notify.watchReload()
+
+	rateLimitCfg, err := loadRateLimitConfig(getenv("RATE_LIMIT_CONFIG", ""))
+	if err != nil {
+		logger.Error("failed to load rate limit config", "error", err)
+		os.Exit(1)
+	}
+	app.RateLimit = rateLimitCfg
+
+	policy, err := loadPolicyConfig(getenv("POLICY_CONFIG", ""))
+	if err != nil {
+		logger.Error("failed to load policy config", "error", err)
+		os.Exit(1)
+	}
+	app.Policy = policy
+
+	searchIdx, err := newSearchIndex()
+	if err != nil {
+		logger.Error("failed to build search index", "error", err)
+		os.Exit(1)
+	}
+	app.Search = searchIdx
+
+	blob, err := newBlobStoreFromEnv()
+	if err != nil {
+		logger.Error("failed to configure blob store", "error", err)
+		os.Exit(1)
+	}
+	app.Blob = blob
+
+	if v := os.Getenv("ATTACHMENT_QUOTA_BYTES"); v != "" {
+		app.QuotaBytes, _ = strconv.ParseInt(v, 10, 64)
+	}
+
 	certFile := "./certs/fullchain.pem"
 	keyFile := "./certs/privkey.pem"
 
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
-		log.Fatalf("❌ Failed to load TLS cert: %v", err)
+		logger.Error("failed to load TLS cert", "error", err)
+		os.Exit(1)
 	}
 
 	tlsConfig := &tls.Config{
@@ -192,9 +380,10 @@ func main() {
 		s.Domain = allowedDomain
 		s.TLSConfig = tlsConfig
 		s.AllowInsecureAuth = false
-		log.Println("SMTP listening on :25")
+		logger.Info("SMTP listening", "addr", s.Addr)
 		if err := s.ListenAndServe(); err != nil {
-			log.Fatal(err)
+			logger.Error("SMTP server failed", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -203,11 +392,27 @@ func main() {
 		key: true,
 	}
 
+	go func() {
+		addr := getenv("IMAP_ADDR", ":143")
+		logger.Info("IMAP listening", "addr", addr)
+		if err := serveIMAP(addr, app, validAPIKeys, tlsConfig); err != nil {
+			logger.Error("IMAP server failed", "error", err)
+			os.Exit(1)
+		}
+	}()
+
 	router := gin.Default()
 	router.Use(func(c *gin.Context) {
 		ip := c.ClientIP()
 		ctx := c.Request.Context()
-		if !allow(ctx, app.Redis, fmt.Sprintf("api:%s", ip), 100, time.Minute) {
+		policy := app.RateLimit.ClientIPRequests
+		res, err := allow(ctx, app.Redis, fmt.Sprintf("ratelimit:api:ip:%s", ip), policy)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setRateLimitHeaders(c.Header, policy, res)
+		if !res.Allowed {
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
 			return
 		}
@@ -216,37 +421,203 @@ func main() {
 
 	router.Use(APIKeyAuthMiddleware(validAPIKeys))
 
+	router.Use(func(c *gin.Context) {
+		key := c.GetHeader("X-API-KEY")
+		ctx := c.Request.Context()
+		policy := app.RateLimit.APIKeyRequests
+		res, err := allow(ctx, app.Redis, fmt.Sprintf("ratelimit:api:key:%s", key), policy)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setRateLimitHeaders(c.Header, policy, res)
+		if !res.Allowed {
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+		c.Next()
+	})
+
+	router.POST("/admin/log-level", func(c *gin.Context) {
+		var body struct {
+			Level string `json:"level"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		level := parseLogLevel(body.Level)
+		logLevel.Set(level)
+		logger.Info("log level changed via admin endpoint", "level", level.String())
+		c.JSON(http.StatusOK, gin.H{"level": level.String()})
+	})
+
+	router.GET("/admin/debug-dump", func(c *gin.Context) {
+		dump := debugDump.Snapshot()
+		out := make([]string, len(dump))
+		for i, d := range dump {
+			out[i] = string(d)
+		}
+		c.JSON(http.StatusOK, gin.H{"payloads": out})
+	})
+
 	router.GET("/emails/:username", func(c *gin.Context) {
 
 		ctx := c.Request.Context()
 		username := c.Param("username")
-		key := fmt.Sprintf("inbox:%s", username)
-		msgs, err := app.Redis.LRange(ctx, key, 0, 49).Result()
 
+		limit := 50
+		if v := c.Query("limit"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				limit = n
+			}
+		}
+		var cursor uint64
+		if v := c.Query("cursor"); v != "" {
+			cursor, _ = strconv.ParseUint(v, 10, 32)
+		}
+
+		filter := messageFilter{
+			From:          c.Query("from"),
+			SubjectSubstr: c.Query("subject"),
+		}
+		if v := c.Query("since"); v != "" {
+			filter.Since, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v := c.Query("until"); v != "" {
+			filter.Until, _ = strconv.ParseInt(v, 10, 64)
+		}
+		if v := c.Query("has:attachment"); v != "" {
+			b := v == "true"
+			filter.HasAttachment = &b
+		}
+
+		uids, err := listUIDs(ctx, app.Redis, username)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
-		var out []map[string]any
-		for _, m := range msgs {
-			var v map[string]any
-			_ = json.Unmarshal([]byte(m), &v)
-			out = append(out, v)
+
+		out, nextCursor := paginateMessages(uids, cursor, limit, filter, func(uid uint32) (*StoredMessage, error) {
+			return loadMessage(ctx, app.Redis, username, uid)
+		})
+
+		resp := gin.H{"messages": out}
+		if len(out) == limit {
+			resp["next_cursor"] = nextCursor
+		}
+		c.JSON(200, resp)
+	})
+
+	router.GET("/emails/:username/search", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		username := c.Param("username")
+		q := c.Query("q")
+		if q == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing q parameter"})
+			return
+		}
+
+		uids, err := app.Search.Search(username, q, 50)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		out := make([]*StoredMessage, 0, len(uids))
+		for _, uid := range uids {
+			msg, err := loadMessage(ctx, app.Redis, username, uid)
+			if err != nil {
+				continue
+			}
+			out = append(out, msg)
 		}
 		c.JSON(200, out)
 	})
 
+	router.GET("/emails/:username/:id", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		username := c.Param("username")
+		uid, err := parseUID(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		msg, err := loadMessage(ctx, app.Redis, username, uid)
+		if err == redis.Nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, msg)
+	})
+
+	router.GET("/emails/:username/:id/attachments/:idx", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		username := c.Param("username")
+		uid, err := parseUID(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		idx, err := strconv.Atoi(c.Param("idx"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment index"})
+			return
+		}
+
+		msg, err := loadMessage(ctx, app.Redis, username, uid)
+		if err == redis.Nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := serveAttachment(app, c, msg, idx); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	})
+
+	router.DELETE("/emails/:username/:id", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		username := c.Param("username")
+		uid, err := parseUID(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := deleteMessage(ctx, app.Redis, username, uid); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		_ = app.Search.Delete(username, uid)
+
+		c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("message %d for %s deleted", uid, username)})
+	})
+
 	router.DELETE("/emails/:username", func(c *gin.Context) {
 		ctx := c.Request.Context()
 
 		username := c.Param("username")
-		key := fmt.Sprintf("inbox:%s", username)
 
-		err := app.Redis.Del(ctx, key).Err()
+		uids, err := listUIDs(ctx, app.Redis, username)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		for _, uid := range uids {
+			_ = deleteMessage(ctx, app.Redis, username, uid)
+			_ = app.Search.Delete(username, uid)
+		}
 
 		c.JSON(http.StatusOK, gin.H{
 			"message": fmt.Sprintf("All messages for %s have been cleared", username),
@@ -265,16 +636,18 @@ func main() {
 	}
 
 	go func() {
-		log.Println("🚀 Starting HTTPS on :443")
+		logger.Info("starting HTTPS", "addr", ":443")
 		if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTPS server failed: %v", err)
+			logger.Error("HTTPS server failed", "error", err)
+			os.Exit(1)
 		}
 	}()
 
 	go func() {
-		log.Println("🌐 Starting HTTP redirect on :80")
+		logger.Info("starting HTTP redirect", "addr", ":80")
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server failed: %v", err)
+			logger.Error("HTTP server failed", "error", err)
+			os.Exit(1)
 		}
 	}()
 
@@ -282,19 +655,19 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	log.Println("🧹 Shutting down servers gracefully...")
+	logger.Info("shutting down servers gracefully")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := httpsServer.Shutdown(ctx); err != nil {
-		log.Printf("Error shutting down HTTPS server: %v", err)
+		logger.Error("error shutting down HTTPS server", "error", err)
 	}
 	if err := httpServer.Shutdown(ctx); err != nil {
-		log.Printf("Error shutting down HTTP server: %v", err)
+		logger.Error("error shutting down HTTP server", "error", err)
 	}
 
-	log.Println("✅ Servers stopped cleanly")
+	logger.Info("servers stopped cleanly")
 }
 
 func getenv(k, d string) string {
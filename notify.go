@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/emersion/go-sasl"
+	"github.com/emersion/go-smtp"
+	"gopkg.in/yaml.v3"
+)
+
+// sinkConfig describes a single notification target. Only the fields
+// relevant to Type are used; the rest are ignored.
+type sinkConfig struct {
+	Type    string `yaml:"type"` // "webhook", "ntfy", "redis", "smtp"
+	URL     string `yaml:"url,omitempty"`
+	Topic   string `yaml:"topic,omitempty"`   // ntfy topic, may contain {user}
+	Channel string `yaml:"channel,omitempty"` // redis pub/sub channel, may contain {user}
+
+	SMTPAddr     string `yaml:"smtp_addr,omitempty"`
+	SMTPFrom     string `yaml:"smtp_from,omitempty"`
+	SMTPTo       string `yaml:"smtp_to,omitempty"`
+	SMTPUser     string `yaml:"smtp_user,omitempty"`
+	SMTPPassword string `yaml:"smtp_password,omitempty"`
+}
+
+// sinkRule maps recipient local-parts to the sinks that should be notified
+// when a message arrives for them. Match is either an exact local-part or a
+// regexp (tried if it fails to match exactly).
+type sinkRule struct {
+	Match string       `yaml:"match"`
+	Sinks []sinkConfig `yaml:"sinks"`
+}
+
+type notifyConfig struct {
+	Rules []sinkRule `yaml:"rules"`
+
+	MaxRetries int           `yaml:"max_retries"`
+	RetryBase  time.Duration `yaml:"retry_base"`
+}
+
+func defaultNotifyConfig() *notifyConfig {
+	return &notifyConfig{MaxRetries: 3, RetryBase: time.Second}
+}
+
+// notifyDispatcher fans out newly delivered messages to configured sinks.
+// The config is loaded once at startup and can be swapped out atomically on
+// SIGHUP without dropping in-flight dispatches.
+type notifyDispatcher struct {
+	app        *App
+	configPath string
+	config     atomic.Pointer[notifyConfig]
+	client     *http.Client
+}
+
+func newNotifyDispatcher(app *App, configPath string) *notifyDispatcher {
+	d := &notifyDispatcher{app: app, configPath: configPath, client: &http.Client{Timeout: 10 * time.Second}}
+	d.config.Store(defaultNotifyConfig())
+	if configPath != "" {
+		if cfg, err := loadNotifyConfig(configPath); err != nil {
+			logger.Error("failed to load notify config, using empty ruleset", "path", configPath, "error", err)
+		} else {
+			d.config.Store(cfg)
+		}
+	}
+	return d
+}
+
+func loadNotifyConfig(path string) (*notifyConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := defaultNotifyConfig()
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// watchReload re-reads configPath on SIGHUP and atomically swaps the active
+// config in, so sink rules can change without restarting the server.
+func (d *notifyDispatcher) watchReload() {
+	if d.configPath == "" {
+		return
+	}
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			cfg, err := loadNotifyConfig(d.configPath)
+			if err != nil {
+				logger.Error("notify config reload failed, keeping previous config", "path", d.configPath, "error", err)
+				continue
+			}
+			d.config.Store(cfg)
+			logger.Info("notify config reloaded", "path", d.configPath, "rules", len(cfg.Rules))
+		}
+	}()
+}
+
+func matchesRule(pattern, username string) bool {
+	if pattern == "*" || pattern == username {
+		return true
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	return re.MatchString(username)
+}
+
+// Dispatch fans msg out to every sink whose rule matches username. Each
+// sink is delivered independently with its own retry/backoff; a failing
+// sink does not block the others and ends up in that sink type's
+// dead-letter list once retries are exhausted.
+func (d *notifyDispatcher) Dispatch(ctx context.Context, username string, msg *StoredMessage) {
+	cfg := d.config.Load()
+
+	var sinks []sinkConfig
+	for _, rule := range cfg.Rules {
+		if matchesRule(rule.Match, username) {
+			sinks = append(sinks, rule.Sinks...)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, sink := range sinks {
+		sink := sink
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliverWithRetry(ctx, sink, username, msg, cfg.MaxRetries, cfg.RetryBase)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *notifyDispatcher) deliverWithRetry(ctx context.Context, sink sinkConfig, username string, msg *StoredMessage, maxRetries int, base time.Duration) {
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(base * time.Duration(1<<uint(attempt-1)))
+		}
+		err = d.deliver(ctx, sink, username, msg)
+		if err == nil {
+			return
+		}
+		logger.Warn("sink delivery failed", "sink_type", sink.Type, "username", username, "attempt", attempt, "error", err)
+	}
+
+	logger.Error("sink delivery exhausted retries, dead-lettering", "sink_type", sink.Type, "username", username, "error", err)
+	d.deadLetter(ctx, sink, username, msg)
+}
+
+func (d *notifyDispatcher) deliver(ctx context.Context, sink sinkConfig, username string, msg *StoredMessage) error {
+	switch sink.Type {
+	case "webhook":
+		return d.deliverWebhook(ctx, sink, msg)
+	case "ntfy":
+		return d.deliverNtfy(ctx, sink, username, msg)
+	case "redis":
+		return d.deliverRedis(ctx, sink, username, msg)
+	case "smtp":
+		return d.deliverSMTPRelay(ctx, sink, msg)
+	default:
+		return fmt.Errorf("unknown sink type: %s", sink.Type)
+	}
+}
+
+func (d *notifyDispatcher) deliverWebhook(ctx context.Context, sink sinkConfig, msg *StoredMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned %d", sink.URL, resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *notifyDispatcher) deliverNtfy(ctx context.Context, sink sinkConfig, username string, msg *StoredMessage) error {
+	topic := expandUser(sink.Topic, username)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, topic, bytes.NewReader([]byte(msg.Subject)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Title", fmt.Sprintf("New mail for %s", username))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy %s returned %d", topic, resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *notifyDispatcher) deliverRedis(ctx context.Context, sink sinkConfig, username string, msg *StoredMessage) error {
+	channel := expandUser(sink.Channel, username)
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return d.app.Redis.Publish(ctx, channel, body).Err()
+}
+
+// deliverSMTPRelay forwards the message to an upstream SMTP server, e.g. so
+// a temp-mailbox address can bridge a login/verification email into a real
+// inbox. Auth uses SASL PLAIN over the credentials in the sink config.
+func (d *notifyDispatcher) deliverSMTPRelay(ctx context.Context, sink sinkConfig, msg *StoredMessage) error {
+	var auth sasl.Client
+	if sink.SMTPUser != "" {
+		auth = sasl.NewPlainClient("", sink.SMTPUser, sink.SMTPPassword)
+	}
+	return smtp.SendMail(sink.SMTPAddr, auth, sink.SMTPFrom, []string{sink.SMTPTo}, bytes.NewReader(msg.Raw))
+}
+
+func (d *notifyDispatcher) deadLetter(ctx context.Context, sink sinkConfig, username string, msg *StoredMessage) {
+	entry := map[string]any{
+		"sink_type": sink.Type,
+		"username":  username,
+		"message":   msg,
+	}
+	j, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	key := fmt.Sprintf("deadletter:%s", sink.Type)
+	d.app.Redis.LPush(ctx, key, j)
+	d.app.Redis.Expire(ctx, key, inboxTTL)
+}
+
+func expandUser(template, username string) string {
+	return strings.ReplaceAll(template, "{user}", username)
+}
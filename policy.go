@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"blitiri.com.ar/go/spf"
+	"github.com/emersion/go-msgauth/dkim"
+	"github.com/redis/go-redis/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// authResult records the outcome of a single sender-policy check so it can
+// be rendered into an Authentication-Results header and surfaced via the
+// JSON API.
+type authResult struct {
+	Method string `json:"method"` // spf, dkim, dmarc, rbl
+	Result string `json:"result"` // pass, fail, none, or any other SPF result (e.g. softfail)
+	Reason string `json:"reason,omitempty"`
+	Domain string `json:"domain,omitempty"` // identity domain the check passed for, used for DMARC alignment
+}
+
+// checkAction controls what happens when a check does not pass: the
+// message is either rejected outright, or allowed through with the result
+// tagged onto Authentication-Results for the recipient to judge.
+type checkAction string
+
+const (
+	actionTag    checkAction = "tag"
+	actionReject checkAction = "reject"
+)
+
+type policyConfig struct {
+	SPF struct {
+		Enabled bool        `yaml:"enabled"`
+		Action  checkAction `yaml:"action"`
+	} `yaml:"spf"`
+	DKIM struct {
+		Enabled bool        `yaml:"enabled"`
+		Action  checkAction `yaml:"action"`
+	} `yaml:"dkim"`
+	DMARC struct {
+		Enabled bool        `yaml:"enabled"`
+		Action  checkAction `yaml:"action"`
+	} `yaml:"dmarc"`
+	RBL struct {
+		Enabled bool        `yaml:"enabled"`
+		Zones   []string    `yaml:"zones"`
+		Action  checkAction `yaml:"action"`
+	} `yaml:"rbl"`
+	Greylist struct {
+		Enabled bool          `yaml:"enabled"`
+		Delay   time.Duration `yaml:"delay"`
+	} `yaml:"greylist"`
+}
+
+func defaultPolicyConfig() *policyConfig {
+	cfg := &policyConfig{}
+	cfg.RBL.Zones = []string{"zen.spamhaus.org"}
+	cfg.Greylist.Delay = 5 * time.Minute
+	return cfg
+}
+
+func loadPolicyConfig(path string) (*policyConfig, error) {
+	cfg := defaultPolicyConfig()
+	if path == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(b, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// checkRBL looks the connecting IP up against each configured DNSBL zone by
+// querying the reversed-octet name, e.g. 2.0.0.127.zen.spamhaus.org.
+func checkRBL(cfg *policyConfig, ip net.IP) authResult {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return authResult{Method: "rbl", Result: "none", Reason: "not an IPv4 address"}
+	}
+	reversed := fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	for _, zone := range cfg.RBL.Zones {
+		if addrs, err := net.LookupHost(reversed + "." + zone); err == nil && len(addrs) > 0 {
+			return authResult{Method: "rbl", Result: "fail", Reason: zone}
+		}
+	}
+	return authResult{Method: "rbl", Result: "pass"}
+}
+
+// checkSPF validates MAIL FROM against the connecting IP's SPF record.
+func checkSPF(ctx context.Context, ip net.IP, from, heloDomain string) authResult {
+	domain := from
+	if at := strings.LastIndex(from, "@"); at != -1 {
+		domain = from[at+1:]
+	}
+	if domain == "" {
+		return authResult{Method: "spf", Result: "none"}
+	}
+	result, err := spf.CheckHostWithSender(ip, heloDomain, from)
+	if err != nil {
+		return authResult{Method: "spf", Result: "none", Reason: err.Error()}
+	}
+	return authResult{Method: "spf", Result: string(result), Domain: domain}
+}
+
+// checkDKIM verifies any DKIM-Signature headers present on the raw
+// message.
+func checkDKIM(raw []byte) authResult {
+	verifications, err := dkim.Verify(bytes.NewReader(raw))
+	if err != nil {
+		return authResult{Method: "dkim", Result: "none", Reason: err.Error()}
+	}
+	if len(verifications) == 0 {
+		return authResult{Method: "dkim", Result: "none"}
+	}
+	for _, v := range verifications {
+		if v.Err != nil {
+			return authResult{Method: "dkim", Result: "fail", Reason: v.Err.Error()}
+		}
+	}
+	return authResult{Method: "dkim", Result: "pass", Reason: verifications[0].Domain, Domain: verifications[0].Domain}
+}
+
+// checkDMARC looks up the _dmarc TXT record for the From: header's domain
+// and reports whether SPF or DKIM passed and aligned with it, per
+// RFC 7489: a pass alone isn't enough unless the passing identity's domain
+// is relaxed-aligned with the From: header domain (see domainsAligned).
+func checkDMARC(fromHeaderDomain string, spfRes, dkimRes authResult) authResult {
+	if fromHeaderDomain == "" {
+		return authResult{Method: "dmarc", Result: "none"}
+	}
+	txts, err := net.LookupTXT("_dmarc." + fromHeaderDomain)
+	if err != nil || len(txts) == 0 {
+		return authResult{Method: "dmarc", Result: "none"}
+	}
+
+	policy := "none"
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, "v=DMARC1") {
+			continue
+		}
+		for _, tag := range strings.Split(txt, ";") {
+			tag = strings.TrimSpace(tag)
+			if p, ok := strings.CutPrefix(tag, "p="); ok {
+				policy = p
+			}
+		}
+	}
+
+	aligned := (spfRes.Result == "pass" && domainsAligned(spfRes.Domain, fromHeaderDomain)) ||
+		(dkimRes.Result == "pass" && domainsAligned(dkimRes.Domain, fromHeaderDomain))
+	if aligned {
+		return authResult{Method: "dmarc", Result: "pass", Reason: "p=" + policy}
+	}
+	return authResult{Method: "dmarc", Result: "fail", Reason: "p=" + policy}
+}
+
+// domainsAligned reports whether a and b satisfy DMARC's relaxed
+// alignment: equal, or one is a subdomain of the other.
+func domainsAligned(a, b string) bool {
+	a, b = strings.ToLower(a), strings.ToLower(b)
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
+
+// checkGreylist tempfails delivery attempts for an (ip, from, to) triple
+// until cfg.Greylist.Delay has elapsed since the triple was first seen, per
+// the standard greylisting anti-spam technique: legitimate MTAs retry after
+// a delay, most spam senders never do. The first-seen timestamp is kept
+// around for twice the delay so a retry just past the window still counts.
+func checkGreylist(ctx context.Context, rdb *redis.Client, cfg *policyConfig, ip, from, to string) bool {
+	if !cfg.Greylist.Enabled {
+		return true
+	}
+	key := fmt.Sprintf("greylist:%s:%s:%s", ip, from, to)
+	now := time.Now().Unix()
+	_, err := rdb.SetNX(ctx, key, now, 2*cfg.Greylist.Delay).Result()
+	if err != nil {
+		return true
+	}
+	firstSeen, err := rdb.Get(ctx, key).Int64()
+	if err != nil {
+		return true
+	}
+	return time.Since(time.Unix(firstSeen, 0)) >= cfg.Greylist.Delay
+}
+
+func fromHeaderDomain(addr string) string {
+	at := strings.LastIndex(addr, "@")
+	if at == -1 {
+		return ""
+	}
+	return addr[at+1:]
+}
+
+func authResultsHeader(domain string, results []authResult) string {
+	parts := make([]string, 0, len(results))
+	for _, r := range results {
+		part := fmt.Sprintf("%s=%s", r.Method, r.Result)
+		if r.Reason != "" {
+			part += fmt.Sprintf(" (%s)", r.Reason)
+		}
+		parts = append(parts, part)
+	}
+	return fmt.Sprintf("Authentication-Results: %s; %s\r\n", domain, strings.Join(parts, "; "))
+}
+
+func anyRejected(cfg *policyConfig, results []authResult) (authResult, checkAction, bool) {
+	for _, r := range results {
+		if r.Result != "fail" {
+			continue
+		}
+		switch r.Method {
+		case "spf":
+			if cfg.SPF.Enabled && cfg.SPF.Action == actionReject {
+				return r, actionReject, true
+			}
+		case "dkim":
+			if cfg.DKIM.Enabled && cfg.DKIM.Action == actionReject {
+				return r, actionReject, true
+			}
+		case "dmarc":
+			if cfg.DMARC.Enabled && cfg.DMARC.Action == actionReject {
+				return r, actionReject, true
+			}
+		case "rbl":
+			if cfg.RBL.Enabled && cfg.RBL.Action == actionReject {
+				return r, actionReject, true
+			}
+		}
+	}
+	return authResult{}, actionTag, false
+}
@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestDomainsAligned(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"exact match", "example.com", "example.com", true},
+		{"case insensitive", "Example.COM", "example.com", true},
+		{"subdomain of b", "mail.example.com", "example.com", true},
+		{"b subdomain of a", "example.com", "mail.example.com", true},
+		{"unrelated domains", "example.com", "attacker.net", false},
+		{"empty a", "", "example.com", false},
+		{"empty b", "example.com", "", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := domainsAligned(tc.a, tc.b); got != tc.want {
+				t.Errorf("domainsAligned(%q, %q) = %v, want %v", tc.a, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestAnyRejected(t *testing.T) {
+	cfg := defaultPolicyConfig()
+	cfg.SPF.Enabled = true
+	cfg.SPF.Action = actionReject
+	cfg.DKIM.Enabled = true
+	cfg.DKIM.Action = actionTag
+
+	results := []authResult{
+		{Method: "dkim", Result: "fail"},
+		{Method: "spf", Result: "fail"},
+	}
+	reason, action, reject := anyRejected(cfg, results)
+	if !reject {
+		t.Fatalf("expected rejection for failing spf check")
+	}
+	if action != actionReject || reason.Method != "spf" {
+		t.Fatalf("got reason=%+v action=%v, want spf/actionReject", reason, action)
+	}
+}
+
+func TestAnyRejectedNoneConfiguredToReject(t *testing.T) {
+	cfg := defaultPolicyConfig()
+	cfg.DKIM.Enabled = true
+	cfg.DKIM.Action = actionTag
+
+	results := []authResult{{Method: "dkim", Result: "fail"}}
+	_, action, reject := anyRejected(cfg, results)
+	if reject {
+		t.Fatalf("expected no rejection when only tag-configured checks fail")
+	}
+	if action != actionTag {
+		t.Fatalf("got action=%v, want actionTag", action)
+	}
+}
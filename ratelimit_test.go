@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestRateLimitPolicyEnabled(t *testing.T) {
+	if (rateLimitPolicy{}).enabled() {
+		t.Fatalf("zero-capacity policy should be disabled")
+	}
+	if !(rateLimitPolicy{Capacity: 1}).enabled() {
+		t.Fatalf("positive-capacity policy should be enabled")
+	}
+}
+
+func TestSetRateLimitHeaders(t *testing.T) {
+	got := map[string]string{}
+	header := func(k, v string) { got[k] = v }
+
+	setRateLimitHeaders(header, rateLimitPolicy{Capacity: 100}, rateLimitResult{Remaining: 42, ResetMS: 5000})
+
+	if got["X-RateLimit-Limit"] != "100" {
+		t.Errorf("X-RateLimit-Limit = %q, want 100", got["X-RateLimit-Limit"])
+	}
+	if got["X-RateLimit-Remaining"] != "42" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 42", got["X-RateLimit-Remaining"])
+	}
+	if got["X-RateLimit-Reset"] != "5" {
+		t.Errorf("X-RateLimit-Reset = %q, want 5", got["X-RateLimit-Reset"])
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+)
+
+// searchDoc is the flattened, full-text-indexed view of a StoredMessage.
+// Only the fields worth querying on are kept; the raw bytes stay in Redis.
+type searchDoc struct {
+	Username      string `json:"username"`
+	From          string `json:"from"`
+	Subject       string `json:"subject"`
+	Body          string `json:"body"`
+	ReceivedAt    int64  `json:"received_at"`
+	HasAttachment bool   `json:"has_attachment"`
+}
+
+// searchIndex is an in-memory bleve index built incrementally as messages
+// are ingested in Session.Data. It backs /emails/:username/search.
+type searchIndex struct {
+	idx bleve.Index
+}
+
+func newSearchIndex() (*searchIndex, error) {
+	idx, err := bleve.NewMemOnly(bleve.NewIndexMapping())
+	if err != nil {
+		return nil, err
+	}
+	return &searchIndex{idx: idx}, nil
+}
+
+func searchDocID(username string, uid uint32) string {
+	return fmt.Sprintf("%s:%d", username, uid)
+}
+
+func (s *searchIndex) Index(username string, msg *StoredMessage) error {
+	doc := searchDoc{
+		Username:      username,
+		From:          msg.From,
+		Subject:       msg.Subject,
+		Body:          msg.BodyText,
+		ReceivedAt:    msg.ReceivedAt,
+		HasAttachment: len(msg.Attachments) > 0,
+	}
+	return s.idx.Index(searchDocID(username, msg.UID), doc)
+}
+
+func (s *searchIndex) Delete(username string, uid uint32) error {
+	return s.idx.Delete(searchDocID(username, uid))
+}
+
+// Search runs q against username's indexed messages and returns the
+// matching UIDs, most relevant first.
+func (s *searchIndex) Search(username, q string, limit int) ([]uint32, error) {
+	// The default mapping runs the standard analyzer (which lowercases)
+	// over indexed text fields, so the term query must match that or an
+	// exact-case username with any uppercase letter never hits.
+	userQuery := bleve.NewTermQuery(strings.ToLower(username))
+	userQuery.SetField("username")
+	textQuery := bleve.NewQueryStringQuery(q)
+
+	req := bleve.NewSearchRequest(bleve.NewConjunctionQuery(userQuery, textQuery))
+	req.Size = limit
+
+	result, err := s.idx.Search(req)
+	if err != nil {
+		return nil, err
+	}
+
+	uids := make([]uint32, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		_, uidPart, ok := strings.Cut(hit.ID, ":")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseUint(uidPart, 10, 32)
+		if err != nil {
+			continue
+		}
+		uids = append(uids, uint32(n))
+	}
+	return uids, nil
+}
+
+// messageFilter narrows a listing by the query params the HTTP API accepts.
+// A zero value matches everything.
+type messageFilter struct {
+	From          string
+	SubjectSubstr string
+	Since         int64
+	Until         int64
+	HasAttachment *bool
+}
+
+// paginateMessages walks uids newest-first, loading and filtering each one,
+// and returns up to limit matches plus the cursor a caller should pass to
+// fetch the next page: the UID of the last message returned, or 0 if none
+// matched. The cursor is set even when no older messages remain, so the
+// caller decides whether another page may exist. Pulled out of the /emails
+// handler so the pagination logic can be unit tested without Redis.
+func paginateMessages(uids []uint32, cursor uint64, limit int, filter messageFilter, load func(uid uint32) (*StoredMessage, error)) ([]*StoredMessage, uint32) {
+	out := make([]*StoredMessage, 0, limit)
+	var nextCursor uint32
+	for i := len(uids) - 1; i >= 0; i-- {
+		uid := uids[i]
+		if cursor != 0 && uint64(uid) >= cursor {
+			continue
+		}
+		msg, err := load(uid)
+		if err != nil || !filter.matches(msg) {
+			continue
+		}
+		out = append(out, msg)
+		nextCursor = uid
+		if len(out) >= limit {
+			break
+		}
+	}
+	return out, nextCursor
+}
+
+func (f messageFilter) matches(msg *StoredMessage) bool {
+	if f.From != "" && !strings.Contains(strings.ToLower(msg.From), strings.ToLower(f.From)) {
+		return false
+	}
+	if f.SubjectSubstr != "" && !strings.Contains(strings.ToLower(msg.Subject), strings.ToLower(f.SubjectSubstr)) {
+		return false
+	}
+	if f.Since != 0 && msg.ReceivedAt < f.Since {
+		return false
+	}
+	if f.Until != 0 && msg.ReceivedAt > f.Until {
+		return false
+	}
+	if f.HasAttachment != nil && (len(msg.Attachments) > 0) != *f.HasAttachment {
+		return false
+	}
+	return true
+}
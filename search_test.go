@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestMessageFilterMatches(t *testing.T) {
+	msg := &StoredMessage{
+		From:        "Alice@Example.com",
+		Subject:     "Weekly Report",
+		ReceivedAt:  1000,
+		Attachments: []AttachmentMeta{{Filename: "report.pdf"}},
+	}
+
+	cases := []struct {
+		name   string
+		filter messageFilter
+		want   bool
+	}{
+		{"empty filter matches", messageFilter{}, true},
+		{"from substring case-insensitive", messageFilter{From: "alice"}, true},
+		{"from substring no match", messageFilter{From: "bob"}, false},
+		{"subject substring case-insensitive", messageFilter{SubjectSubstr: "report"}, true},
+		{"subject substring no match", messageFilter{SubjectSubstr: "invoice"}, false},
+		{"since excludes earlier", messageFilter{Since: 1001}, false},
+		{"since includes equal", messageFilter{Since: 1000}, true},
+		{"until excludes later", messageFilter{Until: 999}, false},
+		{"has attachment true matches", messageFilter{HasAttachment: boolPtr(true)}, true},
+		{"has attachment false excludes", messageFilter{HasAttachment: boolPtr(false)}, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.filter.matches(msg); got != tc.want {
+				t.Errorf("matches() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestPaginateMessages(t *testing.T) {
+	store := map[uint32]*StoredMessage{
+		1: {UID: 1, Subject: "one"},
+		2: {UID: 2, Subject: "two"},
+		3: {UID: 3, Subject: "three"},
+		4: {UID: 4, Subject: "four"},
+	}
+	load := func(uid uint32) (*StoredMessage, error) {
+		msg, ok := store[uid]
+		if !ok {
+			return nil, fmt.Errorf("no message %d", uid)
+		}
+		return msg, nil
+	}
+
+	out, next := paginateMessages([]uint32{1, 2, 3, 4}, 0, 2, messageFilter{}, load)
+	if len(out) != 2 || out[0].UID != 4 || out[1].UID != 3 {
+		t.Fatalf("first page = %+v, want [4, 3]", out)
+	}
+	if next != 3 {
+		t.Fatalf("next cursor = %d, want 3", next)
+	}
+
+	out, next = paginateMessages([]uint32{1, 2, 3, 4}, uint64(next), 2, messageFilter{}, load)
+	if len(out) != 2 || out[0].UID != 2 || out[1].UID != 1 {
+		t.Fatalf("second page = %+v, want [2, 1]", out)
+	}
+	if next != 1 {
+		t.Fatalf("next cursor = %d, want 1", next)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StoredMessage is the canonical on-disk shape for a delivered message.
+// Raw holds the full RFC 5322 bytes so the IMAP backend can serve them
+// verbatim; the remaining fields are a flattened index kept alongside so
+// the JSON API and IMAP FETCH summaries don't need to reparse Raw.
+type StoredMessage struct {
+	UID         uint32           `json:"uid"`
+	From        string           `json:"from"`
+	To          string           `json:"to"`
+	Subject     string           `json:"subject"`
+	BodyText    string           `json:"body_text"`
+	BodyHTML    string           `json:"body_html"`
+	Attachments []AttachmentMeta `json:"attachments"`
+	ReceivedAt  int64            `json:"received_at"`
+	Flags       []string         `json:"flags"`
+	AuthResults []authResult     `json:"auth_results,omitempty"`
+	Raw         []byte           `json:"-"`
+}
+
+func inboxKey(username string) string    { return fmt.Sprintf("inbox:%s", username) }
+func messageKey(username string, uid uint32) string {
+	return fmt.Sprintf("msg:%s:%d", username, uid)
+}
+func uidCounterKey(username string) string { return fmt.Sprintf("inbox:%s:uidnext", username) }
+
+const inboxTTL = 24 * time.Hour
+
+// saveMessage assigns the next UID for username and persists msg as both
+// the raw bytes (for IMAP) and a flattened hash (for fast listing).
+// It also records the UID in the per-user ordered set that backs LIST/FETCH
+// sequence numbers.
+func saveMessage(ctx context.Context, rdb *redis.Client, username string, msg *StoredMessage) (uint32, error) {
+	uid, err := rdb.Incr(ctx, uidCounterKey(username)).Result()
+	if err != nil {
+		return 0, err
+	}
+	msg.UID = uint32(uid)
+
+	authResultsJSON, _ := json.Marshal(msg.AuthResults)
+	attachmentsJSON, _ := json.Marshal(msg.Attachments)
+
+	key := messageKey(username, msg.UID)
+	fields := map[string]any{
+		"uid":          msg.UID,
+		"from":         msg.From,
+		"to":           msg.To,
+		"subject":      msg.Subject,
+		"body_text":    msg.BodyText,
+		"body_html":    msg.BodyHTML,
+		"attachments":  attachmentsJSON,
+		"received_at":  msg.ReceivedAt,
+		"flags":        strings.Join(msg.Flags, " "),
+		"auth_results": authResultsJSON,
+		"raw":          msg.Raw,
+	}
+
+	pipe := rdb.TxPipeline()
+	pipe.HSet(ctx, key, fields)
+	pipe.Expire(ctx, key, inboxTTL)
+	pipe.ZAdd(ctx, inboxKey(username), redis.Z{Score: float64(msg.UID), Member: msg.UID})
+	pipe.Expire(ctx, inboxKey(username), inboxTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return msg.UID, nil
+}
+
+// listUIDs returns the UIDs in username's inbox, oldest first.
+func listUIDs(ctx context.Context, rdb *redis.Client, username string) ([]uint32, error) {
+	raw, err := rdb.ZRange(ctx, inboxKey(username), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	uids := make([]uint32, 0, len(raw))
+	for _, s := range raw {
+		n, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			continue
+		}
+		uids = append(uids, uint32(n))
+	}
+	return uids, nil
+}
+
+func loadMessage(ctx context.Context, rdb *redis.Client, username string, uid uint32) (*StoredMessage, error) {
+	vals, err := rdb.HGetAll(ctx, messageKey(username, uid)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(vals) == 0 {
+		return nil, redis.Nil
+	}
+	return hashToMessage(vals), nil
+}
+
+func hashToMessage(vals map[string]string) *StoredMessage {
+	receivedAt, _ := strconv.ParseInt(vals["received_at"], 10, 64)
+	uid64, _ := strconv.ParseUint(vals["uid"], 10, 32)
+
+	var attachments []AttachmentMeta
+	if a := vals["attachments"]; a != "" {
+		_ = json.Unmarshal([]byte(a), &attachments)
+	}
+	var flags []string
+	if f := vals["flags"]; f != "" {
+		flags = strings.Fields(f)
+	}
+	var authResults []authResult
+	if a := vals["auth_results"]; a != "" {
+		_ = json.Unmarshal([]byte(a), &authResults)
+	}
+
+	return &StoredMessage{
+		UID:         uint32(uid64),
+		From:        vals["from"],
+		To:          vals["to"],
+		Subject:     vals["subject"],
+		BodyText:    vals["body_text"],
+		BodyHTML:    vals["body_html"],
+		Attachments: attachments,
+		ReceivedAt:  receivedAt,
+		Flags:       flags,
+		AuthResults: authResults,
+		Raw:         []byte(vals["raw"]),
+	}
+}
+
+func deleteMessage(ctx context.Context, rdb *redis.Client, username string, uid uint32) error {
+	pipe := rdb.TxPipeline()
+	pipe.Del(ctx, messageKey(username, uid))
+	pipe.ZRem(ctx, inboxKey(username), uid)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func setFlags(ctx context.Context, rdb *redis.Client, username string, uid uint32, flags []string) error {
+	return rdb.HSet(ctx, messageKey(username, uid), "flags", strings.Join(flags, " ")).Err()
+}